@@ -84,10 +84,33 @@ func (da *Cedar) vKeyOf(id int) (value int, err error) {
 
 // Insert adds a key-value pair into the cedar.
 // It will return ErrInvalidValue, if value < 0 or >= valueLimit.
+//
+// key may use the '*', '?', '[abc]'/'[^abc]' and '*{m,n}' wildcard
+// metacharacters understood by FindOne/FindAll; Insert compiles them into
+// the trie and returns ErrInvalidPattern if they are malformed. A key that
+// uses none of them is stored exactly as given.
+//
+// Insert returns ErrReadOnly if da was loaded from a snapshot (UnmarshalBinary,
+// UnmarshalBinaryFunc, ReadFrom or LoadMmap); see ErrReadOnly for why.
 func (da *Cedar) Insert(key []byte, value interface{}) error {
+	if da.readOnly {
+		return ErrReadOnly
+	}
+	key, err := compilePattern(key)
+	if err != nil {
+		return err
+	}
 	k := da.vKey()
 	klen := len(key)
 	p := da.get(key, 0, 0)
+	// get() may have attached new children to nodes along the path, which
+	// invalidates any cached dense bitmap for them; walk the same path again
+	// via child() (a plain lookup, not a mutation) and drop each one, the
+	// way Delete already does for the nodes it touches.
+	for i, nid := 0, 0; i < len(key); i++ {
+		da.invalidateDense(nid)
+		nid, _ = da.child(nid, key[i])
+	}
 	//fmt.Printf("k:%s, v:%d\n", string(key), value)
 	da.array[p].Value = k
 	da.info[p].End = true
@@ -110,7 +133,13 @@ func (da *Cedar) Update(key []byte, value int) error {
 
 // Delete removes a key-value pair from the cedar.
 // It will return ErrNoPath, if the key has not been added.
+//
+// Delete returns ErrReadOnly if da was loaded from a snapshot (UnmarshalBinary,
+// UnmarshalBinaryFunc, ReadFrom or LoadMmap); see ErrReadOnly for why.
 func (da *Cedar) Delete(key []byte) (err error) {
+	if da.readOnly {
+		return ErrReadOnly
+	}
 	// if the path does not exist, or the end is not a leaf, nothing to delete
 	to, err := da.Jump(key, 0)
 	if err != nil {
@@ -140,12 +169,14 @@ func (da *Cedar) Delete(key []byte) (err error) {
 		if da.info[to].Sibling != 0 || da.info[from].Child != label {
 			// delete the label from the child ring first
 			da.popSibling(from, base, label)
+			da.invalidateDense(from)
 			// then release the current node `to` to the empty node ring
 			da.pushEnode(to)
 			break
 		}
 		// otherwise, just release the current node `to` to the empty node ring
 		da.pushEnode(to)
+		da.invalidateDense(from)
 		// then check its parent node
 		to = from
 	}
@@ -268,7 +299,9 @@ func getsnidpos(a *[]*snidpos) *snidpos {
 	return nil, ErrNoValue
 }*/
 
-// FindOne works like Get but interpret node label * as wildcard
+// FindOne works like Get but interpret node label * as wildcard. It also
+// understands '?', '[abc]'/'[^abc]' and bounded '*{m,n}' rules inserted via
+// Insert.
 func (da *Cedar) FindOne(key []byte) (value interface{}, err error) {
 	tnid := -1
 	nid := 0
@@ -293,6 +326,30 @@ func (da *Cedar) FindOne(key []byte) (value interface{}, err error) {
 		mPool.Put(m)
 	}()
 
+	mb := mPool.Get().(*map[int]struct{})
+	defer func() {
+		for k := range *mb {
+			delete(*mb, k)
+		}
+		mPool.Put(mb)
+	}()
+
+	ma := mPool.Get().(*map[int]struct{})
+	defer func() {
+		for k := range *ma {
+			delete(*ma, k)
+		}
+		mPool.Put(ma)
+	}()
+
+	mc := mPool.Get().(*map[int]struct{})
+	defer func() {
+		for k := range *mc {
+			delete(*mc, k)
+		}
+		mPool.Put(mc)
+	}()
+
 ssLoop:
 	for len(*ss) > 0 {
 		sp = (*ss)[len(*ss)-1]
@@ -305,47 +362,116 @@ ssLoop:
 		}
 
 		for i := pos; i <= e; i++ {
-			if _, ok := (*m)[nid]; !ok && da.hasLabel(nid, '*') {
+			if _, ok := (*m)[nid]; !ok && da.fastHasLabel(nid, '*') {
 				(*m)[nid] = struct{}{}
 				spnid, _ := da.child(nid, '*')
 				if da.isEnd(spnid) {
 					tnid = spnid
 					break ssLoop
-				} else if i < e {
+				} else if next, aerr := da.advance(key, i); aerr != nil {
+					err = ErrInvalidUTF8
+					break ssLoop
+				} else if next <= e {
 					sp := getsnidpos(ss)
-					sp.pos = i + 1
+					sp.pos = next
 					sp.nid = spnid
 				}
 			}
 
-			b := key[i]
-			if b != '*' && da.hasLabel(nid, b) {
-				nid, _ = da.child(nid, b)
-				if i == e {
-					if da.isEnd(nid) {
-						tnid = nid
+			if _, ok := (*mb)[nid]; !ok && da.fastHasLabel(nid, boundedStarMarker) {
+				(*mb)[nid] = struct{}{}
+				bsnid, _ := da.child(nid, boundedStarMarker)
+				for _, bs := range da.readBoundedStars(bsnid) {
+					for c := int(bs.lo); c <= int(bs.hi); c++ {
+						p, ok := da.advanceN(key, i, c)
+						if !ok {
+							break
+						}
+						if p == e+1 {
+							if da.isEnd(bs.cont) {
+								tnid = bs.cont
+								break ssLoop
+							}
+							continue
+						}
+						sp := getsnidpos(ss)
+						sp.pos = p
+						sp.nid = bs.cont
+					}
+				}
+			}
+
+			// A node can hold both a literal child for key[i] and a '?'/class
+			// alternative; matchStep always prefers the literal one, so if
+			// that branch later dead-ends the search needs a way back to the
+			// alternative instead of aborting. Push it onto the stack now,
+			// the same way '*' and '*{m,n}' already do above.
+			if _, ok := (*ma)[nid]; !ok && da.fastHasLabel(nid, key[i]) && da.fastHasLabel(nid, anyMarker) {
+				(*ma)[nid] = struct{}{}
+				if next, aerr := da.advance(key, i); aerr != nil {
+					err = ErrInvalidUTF8
+					break ssLoop
+				} else {
+					anid, _ := da.child(nid, anyMarker)
+					sp := getsnidpos(ss)
+					sp.pos = next
+					sp.nid = anid
+				}
+			}
+
+			if _, ok := (*mc)[nid]; !ok && da.fastHasLabel(nid, key[i]) && da.fastHasLabel(nid, classMarker) {
+				(*mc)[nid] = struct{}{}
+				cnid, _ := da.child(nid, classMarker)
+				if cont, ok := da.classMatches(cnid, key[i]); ok {
+					if next, aerr := da.advance(key, i); aerr != nil {
+						err = ErrInvalidUTF8
 						break ssLoop
 					} else {
-						if sp != nil {
-							*ss = (*ss)[:len(*ss)-1]
-						}
+						sp := getsnidpos(ss)
+						sp.pos = next
+						sp.nid = cont
+					}
+				}
+			}
 
-						snid := nid
-						for {
-							if !da.hasLabel(snid, '*') {
-								break
+			if key[i] != '*' {
+				to, consumed, matched, bad := da.matchStep(key, i, nid)
+				if bad {
+					err = ErrInvalidUTF8
+					break ssLoop
+				}
+				if matched {
+					nid = to
+					last := i + consumed - 1
+					if last == e {
+						if da.isEnd(nid) {
+							tnid = nid
+							break ssLoop
+						} else {
+							if sp != nil {
+								*ss = (*ss)[:len(*ss)-1]
 							}
-							snid, _ = da.child(snid, '*')
-							if da.isEnd(snid) {
-								tnid = snid
-								break ssLoop
+
+							snid := nid
+							for {
+								if !da.fastHasLabel(snid, '*') {
+									break
+								}
+								snid, _ = da.child(snid, '*')
+								if da.isEnd(snid) {
+									tnid = snid
+									break ssLoop
+								}
 							}
-						}
 
-						break
+							break
+						}
 					}
+					i = last
+					continue
 				}
-			} else if sp != nil {
+			}
+			if sp != nil {
 				sp.pos++
 				if sp.pos > e {
 					*ss = (*ss)[:len(*ss)-1]
@@ -357,6 +483,10 @@ ssLoop:
 		}
 	}
 
+	if err != nil {
+		return nil, err
+	}
+
 	if tnid == -1 {
 		return nil, ErrNoPath
 	}
@@ -371,6 +501,9 @@ ssLoop:
 	return nil, ErrNoValue
 }
 
+// FindAll works like FindOne but reports every rule that matches key instead
+// of stopping at the first one. It understands the same '*', '?',
+// '[abc]'/'[^abc]' and bounded '*{m,n}' grammar.
 func (da *Cedar) FindAll(key []byte, valCb func(val interface{}, rule []byte)) {
 	nid := 0
 	e := len(key) - 1
@@ -394,6 +527,30 @@ func (da *Cedar) FindAll(key []byte, valCb func(val interface{}, rule []byte)) {
 		mPool.Put(m)
 	}()
 
+	mb := mPool.Get().(*map[int]struct{})
+	defer func() {
+		for k := range *mb {
+			delete(*mb, k)
+		}
+		mPool.Put(mb)
+	}()
+
+	ma := mPool.Get().(*map[int]struct{})
+	defer func() {
+		for k := range *ma {
+			delete(*ma, k)
+		}
+		mPool.Put(ma)
+	}()
+
+	mc := mPool.Get().(*map[int]struct{})
+	defer func() {
+		for k := range *mc {
+			delete(*mc, k)
+		}
+		mPool.Put(mc)
+	}()
+
 ssLoop:
 	for len(*ss) > 0 {
 		sp = (*ss)[len(*ss)-1]
@@ -406,7 +563,7 @@ ssLoop:
 		}
 
 		for i := pos; i <= e; i++ {
-			if _, ok := (*m)[nid]; !ok && da.hasLabel(nid, '*') {
+			if _, ok := (*m)[nid]; !ok && da.fastHasLabel(nid, '*') {
 				(*m)[nid] = struct{}{}
 				spnid, _ := da.child(nid, '*')
 				if da.isEnd(spnid) {
@@ -419,21 +576,96 @@ ssLoop:
 						valCb(v.Value, rule)
 					}
 					continue ssLoop
-				} else if i < e {
+				} else if next, aerr := da.advance(key, i); aerr != nil {
+					return
+				} else if next <= e {
 					sp := getsnidpos(ss)
-					sp.pos = i + 1
+					sp.pos = next
 					sp.nid = spnid
 				}
 			}
 
-			b := key[i]
-			if b != '*' && da.hasLabel(nid, b) {
-				nid, _ = da.child(nid, b)
+			if _, ok := (*mb)[nid]; !ok && da.fastHasLabel(nid, boundedStarMarker) {
+				(*mb)[nid] = struct{}{}
+				bsnid, _ := da.child(nid, boundedStarMarker)
+				for _, bs := range da.readBoundedStars(bsnid) {
+					for c := int(bs.lo); c <= int(bs.hi); c++ {
+						p, ok := da.advanceN(key, i, c)
+						if !ok {
+							break
+						}
+						if p == e+1 {
+							if da.isEnd(bs.cont) {
+								if vk, err := da.vKeyOf(bs.cont); err == nil {
+									if v, ok := da.vals[vk]; ok {
+										rule, _ := da.Key(bs.cont)
+										valCb(v.Value, rule)
+									}
+								}
+							}
+							continue
+						}
+						sp := getsnidpos(ss)
+						sp.pos = p
+						sp.nid = bs.cont
+					}
+				}
+			}
 
-				if i == e {
+			// A node can hold both a literal child for key[i] and a '?'/class
+			// alternative; matchStep always prefers the literal one, so if
+			// that branch later dead-ends the search needs a way back to the
+			// alternative instead of giving up on the rest of the key. Push
+			// it onto the stack now, the same way '*' and '*{m,n}' already do
+			// above.
+			if _, ok := (*ma)[nid]; !ok && da.fastHasLabel(nid, key[i]) && da.fastHasLabel(nid, anyMarker) {
+				(*ma)[nid] = struct{}{}
+				if next, aerr := da.advance(key, i); aerr != nil {
+					return
+				} else {
+					anid, _ := da.child(nid, anyMarker)
+					sp := getsnidpos(ss)
+					sp.pos = next
+					sp.nid = anid
+				}
+			}
+
+			if _, ok := (*mc)[nid]; !ok && da.fastHasLabel(nid, key[i]) && da.fastHasLabel(nid, classMarker) {
+				(*mc)[nid] = struct{}{}
+				cnid, _ := da.child(nid, classMarker)
+				if cont, ok := da.classMatches(cnid, key[i]); ok {
+					if next, aerr := da.advance(key, i); aerr != nil {
+						return
+					} else {
+						sp := getsnidpos(ss)
+						sp.pos = next
+						sp.nid = cont
+					}
+				}
+			}
+
+			if key[i] != '*' {
+				to, consumed, matched, bad := da.matchStep(key, i, nid)
+				if bad {
+					return
+				}
+				if !matched {
+					if sp != nil {
+						sp.pos++
+						if sp.pos > e {
+							*ss = (*ss)[:len(*ss)-1]
+						}
+						break
+					}
+					break
+				}
+				nid = to
+				last := i + consumed - 1
+
+				if last == e {
 					snid := nid
 					for {
-						if !da.hasLabel(snid, '*') {
+						if !da.fastHasLabel(snid, '*') {
 							break
 						}
 						snid, _ = da.child(snid, '*')
@@ -471,6 +703,9 @@ ssLoop:
 							*ss = (*ss)[:len(*ss)-1]
 						}
 					}
+				} else {
+					i = last
+					continue
 				}
 			} else if sp != nil {
 				sp.pos++
@@ -0,0 +1,82 @@
+package cedar
+
+import "sort"
+
+// Pair is a single key/value entry passed to Build.
+type Pair struct {
+	Key   []byte
+	Value interface{}
+}
+
+// Build inserts all of pairs into the cedar, sorted by Key.
+//
+// This is sorted incremental insert, not the cedarwood batch-construction
+// algorithm (compute each prefix's distinct next-byte set and allocate one
+// contiguous base for all of its siblings at once). pairs does not need to be
+// sorted beforehand; Build sorts it lexicographically by Key before walking
+// it. Keys that share a leading run of bytes with their predecessor in sorted
+// order are resumed from the node where the two keys diverge instead of being
+// re-walked from the root, so the number of node lookups Build performs is
+// proportional to the size of the resulting trie rather than to the sum of
+// the key lengths. But each node is still created one at a time through the
+// same get/child path Insert uses, so Build triggers exactly as many
+// base-array relocations as inserting every pair with Insert would; it saves
+// root-to-prefix walking, not base-array churn, and is not the "one shot"
+// empty-node-ring consumption tens-of-millions-of-keys dictionaries want from
+// real batch construction.
+//
+// Build does not require pairs to be free of duplicate keys; as with Insert, a
+// later pair silently overwrites the value of an earlier pair with the same
+// key.
+func (da *Cedar) Build(pairs []Pair) error {
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return string(pairs[i].Key) < string(pairs[j].Key)
+	})
+
+	// path[i] is the node reached after consuming i bytes of the previously
+	// inserted key, i.e. path[i] == Jump(prevKey[:i], 0). It lets the next
+	// key resume from its common prefix with prevKey instead of from root.
+	path := []int{0}
+	var prev []byte
+
+	for _, pr := range pairs {
+		key := pr.Key
+
+		cl := commonPrefixLen(prev, key)
+		if cl >= len(path) {
+			cl = len(path) - 1
+		}
+		path = path[:cl+1]
+
+		p := da.get(key, path[cl], cl)
+		for i, nid := cl, path[cl]; i < len(key); i++ {
+			nid, _ = da.child(nid, key[i])
+			path = append(path, nid)
+		}
+
+		k := da.vKey()
+		da.array[p].Value = k
+		da.info[p].End = true
+		da.vals[k] = nvalue{Len: len(key), Value: pr.Value}
+
+		prev = key
+	}
+	return nil
+}
+
+func commonPrefixLen(a, b []byte) int {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
@@ -0,0 +1,28 @@
+package cedar
+
+import "testing"
+
+func TestBuild(t *testing.T) {
+	m := NewCedar()
+
+	pairs := []Pair{
+		{Key: []byte("bbb"), Value: 2},
+		{Key: []byte("aaa"), Value: 1},
+		{Key: []byte("aa"), Value: 0},
+	}
+
+	if err := m.Build(pairs); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range pairs {
+		v, err := m.Get(want.Key)
+		if err != nil {
+			t.Errorf("Get(%q): %v", want.Key, err)
+			continue
+		}
+		if v.(int) != want.Value.(int) {
+			t.Errorf("Get(%q) = %v, want %v", want.Key, v, want.Value)
+		}
+	}
+}
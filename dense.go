@@ -0,0 +1,109 @@
+package cedar
+
+import "sync"
+
+// Options configures a Cedar built with NewCedarWithOptions.
+type Options struct {
+	// DenseNodeThreshold is the child count a node has to exceed before a
+	// 256-bit label bitmap (four uint64s) is lazily attached to it. Once
+	// attached, hasLabel-style checks against that node answer from the
+	// bitmap instead of probing the base array, which keeps hot nodes
+	// (root, nodes under a '*') out of the array's cache-unfriendly random
+	// access pattern. Zero disables dense nodes.
+	DenseNodeThreshold int
+}
+
+// NewCedarWithOptions works like NewCedar but enables the per-node label
+// bitmap described by opts. It is meant for dictionaries that are built once
+// and then queried many times, especially through the wildcard-heavy
+// FindOne/FindAll paths, where the bitmap's few hundred bytes per dense node
+// pay for themselves quickly; small tries should keep using NewCedar so they
+// stay compact.
+func NewCedarWithOptions(opts Options) *Cedar {
+	da := NewCedar()
+	da.denseThreshold = opts.DenseNodeThreshold
+	if opts.DenseNodeThreshold > 0 {
+		da.dense = make(map[int]*[4]uint64)
+	}
+	return da
+}
+
+// fastHasLabel answers the same question as hasLabel but, once a node has
+// been promoted to dense, does it with a single word test instead of a probe
+// into the base array.
+//
+// NewCedarWithOptions exists precisely so a trie can be built once and then
+// queried from many goroutines at once, so promoting a node to dense here has
+// to be safe against two goroutines hitting the same cold node concurrently:
+// reads take denseMu for reading, and the promotion itself takes it for
+// writing and re-checks da.dense so only one of the racing goroutines'
+// bitmaps wins.
+func (da *Cedar) fastHasLabel(nid int, b byte) bool {
+	if da.denseThreshold <= 0 {
+		return da.hasLabel(nid, b)
+	}
+	da.denseMu.RLock()
+	bm, ok := da.dense[nid]
+	da.denseMu.RUnlock()
+	if ok {
+		return bitmapTest(bm, b)
+	}
+	if da.childCount(nid) <= da.denseThreshold {
+		return da.hasLabel(nid, b)
+	}
+	bm = da.buildBitmap(nid)
+	da.denseMu.Lock()
+	if existing, ok := da.dense[nid]; ok {
+		bm = existing
+	} else {
+		da.dense[nid] = bm
+	}
+	da.denseMu.Unlock()
+	return bitmapTest(bm, b)
+}
+
+// childCount walks nid's sibling ring, the same ring begin()/next() already
+// follow for prefix enumeration, and counts how many labels it holds.
+func (da *Cedar) childCount(nid int) int {
+	n := 0
+	for c := da.info[nid].Child; c != 0; {
+		n++
+		to := da.array[nid].base() ^ int(c)
+		c = da.info[to].Sibling
+	}
+	return n
+}
+
+// buildBitmap walks nid's sibling ring once and records every label it
+// holds into a 256-bit bitmap.
+func (da *Cedar) buildBitmap(nid int) *[4]uint64 {
+	var bm [4]uint64
+	for c := da.info[nid].Child; c != 0; {
+		bitmapSet(&bm, c)
+		to := da.array[nid].base() ^ int(c)
+		c = da.info[to].Sibling
+	}
+	return &bm
+}
+
+// invalidateDense drops nid's cached bitmap, if any, so it is rebuilt from
+// the sibling ring the next time it is consulted. Insert/Delete call this
+// whenever they change nid's children; the write is guarded by the same
+// denseMu as fastHasLabel's promotion path since Insert/Delete can run
+// concurrently with readers querying other parts of the trie.
+func (da *Cedar) invalidateDense(nid int) {
+	if da.dense == nil {
+		return
+	}
+	da.denseMu.Lock()
+	delete(da.dense, nid)
+	da.denseMu.Unlock()
+}
+
+func bitmapSet(bm *[4]uint64, b byte) {
+	bm[b>>6] |= 1 << (b & 63)
+}
+
+func bitmapTest(bm *[4]uint64, b byte) bool {
+	return bm[b>>6]&(1<<(b&63)) != 0
+}
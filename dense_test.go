@@ -0,0 +1,27 @@
+package cedar
+
+import "testing"
+
+func TestNewCedarWithOptionsDenseLookup(t *testing.T) {
+	m := NewCedarWithOptions(Options{DenseNodeThreshold: 2})
+
+	// Give the node after "a" more children than the threshold so it gets
+	// promoted to a dense bitmap, then exercise it through FindOne, which is
+	// the hot path fastHasLabel backs.
+	words := []string{"aa*", "ab*", "ac*", "ad*"}
+	for i, w := range words {
+		_ = m.Insert([]byte(w), i+1)
+	}
+
+	v, err := m.FindOne([]byte("ac-anything"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.(int) != 3 {
+		t.Errorf("FindOne(%q) = %v, want 3", "ac-anything", v)
+	}
+
+	if _, err := m.FindOne([]byte("ax-anything")); err == nil {
+		t.Errorf("FindOne should not have matched a label outside the trie")
+	}
+}
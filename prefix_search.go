@@ -0,0 +1,46 @@
+package cedar
+
+// Match is one hit produced by CommonPrefixSearch: the value stored at a key
+// that is a prefix of the search key, together with the number of leading
+// bytes of the search key that key consumes.
+type Match struct {
+	Value interface{}
+	Len   int
+}
+
+// CommonPrefixSearch walks key from the root and returns every stored key
+// that is a prefix of key, in the order they are encountered (shortest
+// first), as the value stored at that key paired with the number of bytes of
+// key it matches.
+//
+// Unlike PrefixMatch, which only returns internal node ids and leaves the
+// caller to call Key/Get per hit, CommonPrefixSearch resolves the value
+// directly while it walks, so each byte of key costs one step down the trie
+// plus a vKeyOf check, with no separate Key/Get traversal per hit.
+func (da *Cedar) CommonPrefixSearch(key []byte) (matches []Match) {
+	da.CommonPrefixSearchFunc(key, func(value interface{}, len int) {
+		matches = append(matches, Match{Value: value, Len: len})
+	})
+	return
+}
+
+// CommonPrefixSearchFunc works like CommonPrefixSearch but invokes cb for
+// each match instead of allocating a slice.
+func (da *Cedar) CommonPrefixSearchFunc(key []byte, cb func(value interface{}, len int)) {
+	from := 0
+	for i, b := range key {
+		if da.array[from].Value >= 0 {
+			return
+		}
+		to := da.array[from].base() ^ int(b)
+		if da.array[to].Check != from {
+			return
+		}
+		from = to
+		if vk, err := da.vKeyOf(from); err == nil {
+			if nv, ok := da.vals[vk]; ok {
+				cb(nv.Value, i+1)
+			}
+		}
+	}
+}
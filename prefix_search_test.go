@@ -0,0 +1,23 @@
+package cedar
+
+import "testing"
+
+func TestCommonPrefixSearch(t *testing.T) {
+	m := NewCedar()
+
+	_ = m.Insert([]byte("a"), 1)
+	_ = m.Insert([]byte("ab"), 2)
+	_ = m.Insert([]byte("abc"), 3)
+
+	matches := m.CommonPrefixSearch([]byte("abcd"))
+
+	want := []Match{{Value: 1, Len: 1}, {Value: 2, Len: 2}, {Value: 3, Len: 3}}
+	if len(matches) != len(want) {
+		t.Fatalf("got %d matches, want %d: %+v", len(matches), len(want), matches)
+	}
+	for i, m := range matches {
+		if m != want[i] {
+			t.Errorf("matches[%d] = %+v, want %+v", i, m, want[i])
+		}
+	}
+}
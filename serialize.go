@@ -0,0 +1,391 @@
+package cedar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"unsafe"
+)
+
+const (
+	snapshotMagic   = "CDR1"
+	snapshotVersion = 1
+
+	// arrayEntrySize and infoEntrySize mirror the on-disk layout writeTo
+	// produces for each node/ninfo: two little-endian machine words for
+	// node.{Value,Check}, and one byte each for ninfo.{Child,Sibling,End}.
+	// decodeMmap uses these to alias mapped bytes directly as []node/[]ninfo
+	// instead of copying them; see canAliasSnapshot.
+	arrayEntrySize = 16
+	infoEntrySize  = 3
+)
+
+// ErrBadSnapshot is returned by UnmarshalBinary and friends when data is not
+// a recognized cedar snapshot. A snapshot whose version byte is not
+// snapshotVersion gets a separate "unsupported snapshot version" error instead.
+var ErrBadSnapshot = fmt.Errorf("cedar: not a valid snapshot")
+
+// ErrReadOnly is returned by Insert and Delete when called on a Cedar loaded
+// from a snapshot (UnmarshalBinary, UnmarshalBinaryFunc, ReadFrom or
+// LoadMmap). None of those restore the empty-node ring pushEnode/popSibling
+// maintain, so mutating a loaded Cedar would corrupt it silently at best; a
+// Cedar loaded via LoadMmap also has its array/info aliased onto read-only
+// mapped memory, where a write would fault the process instead of returning
+// an error, which is exactly why this check exists.
+var ErrReadOnly = fmt.Errorf("cedar: cannot Insert/Delete into a Cedar loaded from a snapshot")
+
+// encodeInt is the default encode callback used by MarshalBinary/WriteTo: it
+// requires every stored value to be a plain int, which covers the common
+// case of using a Cedar as a set or as key -> small-integer-id map.
+func encodeInt(v interface{}) ([]byte, error) {
+	n, ok := v.(int)
+	if !ok {
+		return nil, fmt.Errorf("cedar: MarshalBinary: value %v is not an int, use MarshalBinaryFunc", v)
+	}
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(n))
+	return b, nil
+}
+
+// decodeInt is the default decode callback used by UnmarshalBinary/ReadFrom,
+// the counterpart of encodeInt.
+func decodeInt(b []byte) (interface{}, error) {
+	if len(b) != 8 {
+		return nil, ErrBadSnapshot
+	}
+	return int(binary.LittleEndian.Uint64(b)), nil
+}
+
+// MarshalBinary encodes the cedar into a versioned, endian-fixed snapshot
+// that UnmarshalBinary can load back without re-inserting any key. It
+// requires every stored value to be a plain int; for other payload types use
+// MarshalBinaryFunc.
+func (da *Cedar) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := da.writeTo(&buf, encodeInt); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalBinaryFunc works like MarshalBinary but encodes each stored value
+// with the supplied callback instead of assuming it is a plain int.
+func (da *Cedar) MarshalBinaryFunc(encode func(interface{}) ([]byte, error)) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := da.writeTo(&buf, encode); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteTo writes a snapshot of the cedar to w, satisfying io.WriterTo. Stored
+// values must be plain ints; use MarshalBinaryFunc and write the result
+// yourself if they are not.
+func (da *Cedar) WriteTo(w io.Writer) (int64, error) {
+	return da.writeTo(w, encodeInt)
+}
+
+func (da *Cedar) writeTo(w io.Writer, encode func(interface{}) ([]byte, error)) (int64, error) {
+	cw := &countingWriter{w: w}
+	hdr := make([]byte, len(snapshotMagic)+1+8+8)
+	copy(hdr, snapshotMagic)
+	hdr[len(snapshotMagic)] = snapshotVersion
+	binary.LittleEndian.PutUint64(hdr[len(snapshotMagic)+1:], uint64(da.size))
+	binary.LittleEndian.PutUint64(hdr[len(snapshotMagic)+9:], uint64(da.capacity))
+	if _, err := cw.Write(hdr); err != nil {
+		return cw.n, err
+	}
+
+	entry := make([]byte, 16)
+	for i := 0; i < da.size; i++ {
+		binary.LittleEndian.PutUint64(entry[0:8], uint64(da.array[i].Value))
+		binary.LittleEndian.PutUint64(entry[8:16], uint64(da.array[i].Check))
+		if _, err := cw.Write(entry); err != nil {
+			return cw.n, err
+		}
+	}
+
+	info := make([]byte, 3)
+	for i := 0; i < da.size; i++ {
+		info[0] = da.info[i].Child
+		info[1] = da.info[i].Sibling
+		if da.info[i].End {
+			info[2] = 1
+		} else {
+			info[2] = 0
+		}
+		if _, err := cw.Write(info); err != nil {
+			return cw.n, err
+		}
+	}
+
+	count := make([]byte, 8)
+	binary.LittleEndian.PutUint64(count, uint64(len(da.vals)))
+	if _, err := cw.Write(count); err != nil {
+		return cw.n, err
+	}
+
+	valHdr := make([]byte, 16)
+	for k, v := range da.vals {
+		payload, err := encode(v.Value)
+		if err != nil {
+			return cw.n, err
+		}
+		binary.LittleEndian.PutUint64(valHdr[0:8], uint64(k))
+		binary.LittleEndian.PutUint64(valHdr[8:16], uint64(v.Len))
+		if _, err := cw.Write(valHdr); err != nil {
+			return cw.n, err
+		}
+		plen := make([]byte, 8)
+		binary.LittleEndian.PutUint64(plen, uint64(len(payload)))
+		if _, err := cw.Write(plen); err != nil {
+			return cw.n, err
+		}
+		if _, err := cw.Write(payload); err != nil {
+			return cw.n, err
+		}
+	}
+
+	return cw.n, nil
+}
+
+// UnmarshalBinary loads a snapshot produced by MarshalBinary or WriteTo,
+// replacing the contents of da. Values are decoded as plain ints; for other
+// payload types use UnmarshalBinaryFunc.
+//
+// The snapshot format only covers the array, info and vals described at
+// writeTo; it does not restore the empty-node ring pushEnode/popSibling
+// maintain, so a da loaded this way is safe to Get/Jump/FindOne/FindAll but
+// returns ErrReadOnly from Insert or Delete.
+func (da *Cedar) UnmarshalBinary(data []byte) error {
+	return da.readFrom(bytes.NewReader(data), decodeInt)
+}
+
+// UnmarshalBinaryFunc works like UnmarshalBinary but decodes each stored
+// value with the supplied callback instead of assuming it is a plain int.
+// The same query-only restriction described at UnmarshalBinary applies.
+func (da *Cedar) UnmarshalBinaryFunc(data []byte, decode func([]byte) (interface{}, error)) error {
+	return da.readFrom(bytes.NewReader(data), decode)
+}
+
+// ReadFrom reads a snapshot written by WriteTo from r, satisfying
+// io.ReaderFrom, and replaces the contents of da. Stored values are decoded
+// as plain ints; use UnmarshalBinaryFunc for other payload types. The same
+// query-only restriction described at UnmarshalBinary applies.
+func (da *Cedar) ReadFrom(r io.Reader) (int64, error) {
+	cr := &countingReader{r: r}
+	if err := da.readFrom(cr, decodeInt); err != nil {
+		return cr.n, err
+	}
+	return cr.n, nil
+}
+
+func (da *Cedar) readFrom(r io.Reader, decode func([]byte) (interface{}, error)) error {
+	hdr := make([]byte, len(snapshotMagic)+1+8+8)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return ErrBadSnapshot
+	}
+	if string(hdr[:len(snapshotMagic)]) != snapshotMagic {
+		return ErrBadSnapshot
+	}
+	if hdr[len(snapshotMagic)] != snapshotVersion {
+		return fmt.Errorf("cedar: unsupported snapshot version %d", hdr[len(snapshotMagic)])
+	}
+	size := int(binary.LittleEndian.Uint64(hdr[len(snapshotMagic)+1:]))
+	capacity := int(binary.LittleEndian.Uint64(hdr[len(snapshotMagic)+9:]))
+
+	*da = *NewCedar()
+	da.readOnly = true
+	da.size = size
+	da.capacity = capacity
+	for da.capacity < da.size {
+		da.capacity *= 2
+	}
+	da.array = make([]node, da.capacity)
+	da.info = make([]ninfo, da.capacity)
+
+	entry := make([]byte, 16)
+	for i := 0; i < size; i++ {
+		if _, err := io.ReadFull(r, entry); err != nil {
+			return ErrBadSnapshot
+		}
+		da.array[i].Value = int(binary.LittleEndian.Uint64(entry[0:8]))
+		da.array[i].Check = int(binary.LittleEndian.Uint64(entry[8:16]))
+	}
+
+	info := make([]byte, 3)
+	for i := 0; i < size; i++ {
+		if _, err := io.ReadFull(r, info); err != nil {
+			return ErrBadSnapshot
+		}
+		da.info[i].Child = info[0]
+		da.info[i].Sibling = info[1]
+		da.info[i].End = info[2] != 0
+	}
+
+	count := make([]byte, 8)
+	if _, err := io.ReadFull(r, count); err != nil {
+		return ErrBadSnapshot
+	}
+	n := int(binary.LittleEndian.Uint64(count))
+
+	valHdr := make([]byte, 16)
+	plenBuf := make([]byte, 8)
+	da.vals = make(map[int]nvalue, n)
+	for i := 0; i < n; i++ {
+		if _, err := io.ReadFull(r, valHdr); err != nil {
+			return ErrBadSnapshot
+		}
+		k := int(binary.LittleEndian.Uint64(valHdr[0:8]))
+		l := int(binary.LittleEndian.Uint64(valHdr[8:16]))
+		if _, err := io.ReadFull(r, plenBuf); err != nil {
+			return ErrBadSnapshot
+		}
+		plen := int(binary.LittleEndian.Uint64(plenBuf))
+		payload := make([]byte, plen)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return ErrBadSnapshot
+		}
+		value, err := decode(payload)
+		if err != nil {
+			return err
+		}
+		da.vals[k] = nvalue{Len: l, Value: value}
+	}
+	return nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// canAliasSnapshot reports whether the running program's node/ninfo layout
+// matches the on-disk encoding closely enough for decodeMmap to alias
+// mapped bytes as []node/[]ninfo in place: the platform must be
+// little-endian, and node/ninfo must have the sizes and field offsets writeTo
+// encodes. decodeMmap falls back to copying, just like readFrom, when it
+// doesn't hold.
+func canAliasSnapshot() bool {
+	probe := uint16(1)
+	littleEndian := *(*byte)(unsafe.Pointer(&probe)) == 1
+	return littleEndian &&
+		unsafe.Sizeof(node{}) == arrayEntrySize && unsafe.Sizeof(ninfo{}) == infoEntrySize &&
+		unsafe.Offsetof(node{}.Value) == 0 && unsafe.Offsetof(node{}.Check) == 8 &&
+		unsafe.Offsetof(ninfo{}.Child) == 0 && unsafe.Offsetof(ninfo{}.Sibling) == 1 &&
+		unsafe.Offsetof(ninfo{}.End) == 2
+}
+
+// aliasNodes reinterprets b, a slice of a memory mapping, as a []node
+// without copying it. b's length must be a multiple of arrayEntrySize.
+func aliasNodes(b []byte) []node {
+	if len(b) == 0 {
+		return nil
+	}
+	return unsafe.Slice((*node)(unsafe.Pointer(&b[0])), len(b)/arrayEntrySize)
+}
+
+// aliasInfo is aliasNodes for the info array.
+func aliasInfo(b []byte) []ninfo {
+	if len(b) == 0 {
+		return nil
+	}
+	return unsafe.Slice((*ninfo)(unsafe.Pointer(&b[0])), len(b)/infoEntrySize)
+}
+
+// decodeMmap parses a snapshot directly out of mapped bytes, the mmap
+// counterpart of readFrom. Where readFrom always allocates fresh array/info
+// slices and copies the file into them, decodeMmap aliases da.array and
+// da.info onto data itself whenever canAliasSnapshot holds, so data's pages
+// remain the only copy of the base array in physical memory. The vals map
+// is still built by copying out of data, since its payloads are decoded
+// into arbitrary values that don't benefit from aliasing. data is left
+// mapped for the lifetime of the returned Cedar.
+func decodeMmap(data []byte) (*Cedar, error) {
+	hdrLen := len(snapshotMagic) + 1 + 8 + 8
+	if len(data) < hdrLen || string(data[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, ErrBadSnapshot
+	}
+	if data[len(snapshotMagic)] != snapshotVersion {
+		return nil, fmt.Errorf("cedar: unsupported snapshot version %d", data[len(snapshotMagic)])
+	}
+	size := int(binary.LittleEndian.Uint64(data[len(snapshotMagic)+1:]))
+
+	da := NewCedar()
+	da.readOnly = true
+	da.size = size
+	da.capacity = size
+
+	off := hdrLen
+	arrayBytes := size * arrayEntrySize
+	infoBytes := size * infoEntrySize
+	if off+arrayBytes+infoBytes > len(data) {
+		return nil, ErrBadSnapshot
+	}
+
+	if canAliasSnapshot() {
+		da.array = aliasNodes(data[off : off+arrayBytes])
+		off += arrayBytes
+		da.info = aliasInfo(data[off : off+infoBytes])
+		off += infoBytes
+	} else {
+		da.array = make([]node, size)
+		for i := 0; i < size; i++ {
+			da.array[i].Value = int(binary.LittleEndian.Uint64(data[off : off+8]))
+			da.array[i].Check = int(binary.LittleEndian.Uint64(data[off+8 : off+16]))
+			off += arrayEntrySize
+		}
+		da.info = make([]ninfo, size)
+		for i := 0; i < size; i++ {
+			da.info[i].Child = data[off]
+			da.info[i].Sibling = data[off+1]
+			da.info[i].End = data[off+2] != 0
+			off += infoEntrySize
+		}
+	}
+
+	if off+8 > len(data) {
+		return nil, ErrBadSnapshot
+	}
+	n := int(binary.LittleEndian.Uint64(data[off : off+8]))
+	off += 8
+
+	da.vals = make(map[int]nvalue, n)
+	for i := 0; i < n; i++ {
+		if off+24 > len(data) {
+			return nil, ErrBadSnapshot
+		}
+		k := int(binary.LittleEndian.Uint64(data[off : off+8]))
+		l := int(binary.LittleEndian.Uint64(data[off+8 : off+16]))
+		plen := int(binary.LittleEndian.Uint64(data[off+16 : off+24]))
+		off += 24
+		if plen < 0 || off+plen > len(data) {
+			return nil, ErrBadSnapshot
+		}
+		value, err := decodeInt(data[off : off+plen])
+		if err != nil {
+			return nil, err
+		}
+		off += plen
+		da.vals[k] = nvalue{Len: l, Value: value}
+	}
+	return da, nil
+}
@@ -0,0 +1,55 @@
+//go:build !windows
+
+package cedar
+
+import (
+	"os"
+	"syscall"
+)
+
+// LoadMmap opens the snapshot at path and mmaps it read-only, then builds a
+// Cedar whose array and info slices alias the mapped bytes directly rather
+// than copying them wherever canAliasSnapshot holds (see decodeMmap; elsewhere
+// they are copied out of the mapping), so the OS shares the backing pages
+// across every process that maps the same path instead of each process
+// holding its own copy of the base array. This is the scenario the mapping
+// exists for: a large pre-built dictionary that many worker processes load
+// and only ever query.
+//
+// The file descriptor is closed once the mapping is established, as usual
+// for mmap; the mapping itself is intentionally left in place for the
+// lifetime of the returned Cedar, since da has nowhere to keep a handle to
+// unmap it later. A Cedar loaded this way returns ErrReadOnly from Insert
+// or Delete instead of faulting on the read-only mapping.
+//
+// LoadMmap relies on syscall.Mmap, which is only available on Unix-like
+// platforms; it is excluded from Windows builds by this file's build tag. See
+// serialize_nommap.go for the stub LoadMmap that platforms without mmap get
+// instead.
+func LoadMmap(path string) (*Cedar, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() == 0 {
+		return nil, ErrBadSnapshot
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(fi.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+
+	da, err := decodeMmap(data)
+	if err != nil {
+		syscall.Munmap(data)
+		return nil, err
+	}
+	return da, nil
+}
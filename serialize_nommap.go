@@ -0,0 +1,16 @@
+//go:build windows
+
+package cedar
+
+import "errors"
+
+// ErrMmapUnsupported is returned by LoadMmap on platforms without
+// syscall.Mmap, currently Windows.
+var ErrMmapUnsupported = errors.New("cedar: LoadMmap is not supported on this platform")
+
+// LoadMmap is unavailable on this platform; use ReadFrom/UnmarshalBinary
+// instead, which copy the snapshot into memory rather than mapping it. See
+// serialize_mmap.go for the real implementation on Unix-like platforms.
+func LoadMmap(path string) (*Cedar, error) {
+	return nil, ErrMmapUnsupported
+}
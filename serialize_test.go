@@ -0,0 +1,56 @@
+package cedar
+
+import "testing"
+
+func TestMarshalUnmarshalBinary(t *testing.T) {
+	m := NewCedar()
+	_ = m.Insert([]byte("ab"), 23)
+	_ = m.Insert([]byte("abc"), 19)
+	_ = m.Insert([]byte("abcd"), 37)
+
+	data, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewCedar()
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"ab", "abc", "abcd"} {
+		want, err := m.Get([]byte(key))
+		if err != nil {
+			t.Fatalf("Get(%q) on original: %v", key, err)
+		}
+		got, err := loaded.Get([]byte(key))
+		if err != nil {
+			t.Fatalf("Get(%q) on loaded: %v", key, err)
+		}
+		if got != want {
+			t.Errorf("Get(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestUnmarshalBinaryReadOnly(t *testing.T) {
+	m := NewCedar()
+	_ = m.Insert([]byte("ab"), 23)
+
+	data, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewCedar()
+	if err := loaded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := loaded.Insert([]byte("cd"), 1); err != ErrReadOnly {
+		t.Errorf("Insert on a loaded Cedar = %v, want ErrReadOnly", err)
+	}
+	if err := loaded.Delete([]byte("ab")); err != ErrReadOnly {
+		t.Errorf("Delete on a loaded Cedar = %v, want ErrReadOnly", err)
+	}
+}
@@ -0,0 +1,79 @@
+package cedar
+
+import "errors"
+
+// Mode selects how FindOne/FindAll advance through the search key when they
+// cross a wildcard label ('*', '?' or a '[abc]'/'[^abc]' class).
+type Mode int
+
+const (
+	// ModeBytes, the default, advances one byte at a time. This is the
+	// original behavior and is correct for ASCII or byte-oriented keys.
+	ModeBytes Mode = iota
+	// ModeUTF8 advances one Unicode code point (1-4 bytes) at a time, so a
+	// single '?' or one step of '*'/'*{m,n}' consumes one full rune of a
+	// CJK or other multibyte key instead of one of its bytes.
+	ModeUTF8
+)
+
+// ErrInvalidUTF8 is returned by FindOne (and silently stops FindAll) when
+// Mode is ModeUTF8 and the search key contains a malformed UTF-8 sequence at
+// the position a wildcard needs to decode one.
+var ErrInvalidUTF8 = errors.New("cedar: invalid UTF-8")
+
+// utf8RuneLen reports how many bytes the UTF-8 sequence starting with lead
+// occupies, decided from the lead byte alone: 0xxxxxxx -> 1, 110xxxxx -> 2,
+// 1110xxxx -> 3, 11110xxx -> 4. Any other lead byte is not a valid sequence
+// start.
+func utf8RuneLen(lead byte) (int, error) {
+	switch {
+	case lead&0x80 == 0x00:
+		return 1, nil
+	case lead&0xE0 == 0xC0:
+		return 2, nil
+	case lead&0xF0 == 0xE0:
+		return 3, nil
+	case lead&0xF8 == 0xF0:
+		return 4, nil
+	default:
+		return 0, ErrInvalidUTF8
+	}
+}
+
+// advance returns the index in key immediately after the single matching
+// unit that starts at i: one byte in ModeBytes, or one full, validated UTF-8
+// rune in ModeUTF8.
+func (da *Cedar) advance(key []byte, i int) (int, error) {
+	if da.Mode != ModeUTF8 {
+		return i + 1, nil
+	}
+	n, err := utf8RuneLen(key[i])
+	if err != nil {
+		return 0, err
+	}
+	if i+n > len(key) {
+		return 0, ErrInvalidUTF8
+	}
+	for j := 1; j < n; j++ {
+		if key[i+j]&0xC0 != 0x80 {
+			return 0, ErrInvalidUTF8
+		}
+	}
+	return i + n, nil
+}
+
+// advanceN advances n matching units from i, stopping and reporting
+// ok == false if key runs out before the nth unit starts.
+func (da *Cedar) advanceN(key []byte, i, n int) (p int, ok bool) {
+	for k := 0; k < n; k++ {
+		if i >= len(key) {
+			return i, false
+		}
+		next, err := da.advance(key, i)
+		if err != nil {
+			return i, false
+		}
+		i = next
+	}
+	return i, true
+}
@@ -0,0 +1,41 @@
+package cedar
+
+import "testing"
+
+func TestFindOneUTF8Mode(t *testing.T) {
+	m := NewCedar()
+	m.Mode = ModeUTF8
+
+	_ = m.Insert([]byte("GET /user/?/profile"), 1)
+	_ = m.Insert([]byte("GET /path/*/end"), 2)
+
+	if v, err := m.FindOne([]byte("GET /user/\xe4\xb8\xad/profile")); err != nil {
+		t.Errorf("FindOne with a CJK rune for '?': %v", err)
+	} else if iv, ok := v.(int); !ok || iv != 1 {
+		t.Errorf("FindOne = %v, want 1", v)
+	}
+
+	if _, err := m.FindOne([]byte("GET /user/\xe4\xb8/profile")); err != ErrInvalidUTF8 {
+		t.Errorf("FindOne with a truncated rune = %v, want ErrInvalidUTF8", err)
+	}
+
+	if v, err := m.FindOne([]byte("GET /path/\xe4\xb8\xad\xe6\x96\x87/end")); err != nil {
+		t.Errorf("FindOne with '*' spanning two CJK runes: %v", err)
+	} else if iv, ok := v.(int); !ok || iv != 2 {
+		t.Errorf("FindOne = %v, want 2", v)
+	}
+}
+
+func TestFindOneBytesModeDefault(t *testing.T) {
+	m := NewCedar()
+
+	_ = m.Insert([]byte("GET /user/?/profile"), 1)
+
+	if m.Mode != ModeBytes {
+		t.Errorf("NewCedar: Mode = %v, want ModeBytes", m.Mode)
+	}
+
+	if _, err := m.FindOne([]byte("GET /user/\xe4\xb8\xad/profile")); err == nil {
+		t.Errorf("FindOne in ModeBytes should not match a multibyte rune against a single '?'")
+	}
+}
@@ -0,0 +1,257 @@
+package cedar
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+)
+
+// Reserved labels used to encode the extended wildcard grammar into the
+// trie. The three markers are chosen from the control-character range so
+// they cannot collide with the ASCII text cedar is normally used to match; as
+// with the pre-existing '*' wildcard, a rule cannot match these bytes
+// literally. The remaining constants are descriptor bytes that only appear
+// after a classMarker. In ModeUTF8 each "byte" below is one rune instead.
+const (
+	anyMarker         byte = 0x01 // '?': exactly one byte
+	classMarker       byte = 0x02 // '[abc]' / '[^abc]': one byte from a set
+	boundedStarMarker byte = 0x03 // '*{m,n}': between m and n bytes
+	classNotNegated   byte = 0x01
+	classNegated      byte = 0x02
+	classEndMarker    byte = 0xFE
+)
+
+// ErrInvalidPattern is returned by Insert when key contains a malformed use
+// of the '[...]' or '*{m,n}' wildcard grammar, such as an unterminated
+// bracket or an out-of-range bound.
+var ErrInvalidPattern = errors.New("cedar: invalid wildcard pattern")
+
+// compilePattern rewrites the metacharacters '?', '[abc]', '[^abc]' and
+// '*{m,n}' into the reserved single-byte markers above, so the rest of the
+// cedar (Insert, FindOne, FindAll) only ever has to deal with plain bytes and
+// markers. A key containing none of these metacharacters, including a bare
+// '*', is returned unchanged, which keeps existing rules behaviorally
+// identical to before this grammar was added.
+func compilePattern(key []byte) ([]byte, error) {
+	out := make([]byte, 0, len(key))
+	for i := 0; i < len(key); i++ {
+		b := key[i]
+		switch {
+		case b == '?':
+			out = append(out, anyMarker)
+
+		case b == '[':
+			j := i + 1
+			neg := false
+			if j < len(key) && key[j] == '^' {
+				neg = true
+				j++
+			}
+			start := j
+			for j < len(key) && key[j] != ']' {
+				j++
+			}
+			if j >= len(key) || j == start || j-start > 255 {
+				return nil, ErrInvalidPattern
+			}
+			class := key[start:j]
+			out = append(out, classMarker)
+			if neg {
+				out = append(out, classNegated)
+			} else {
+				out = append(out, classNotNegated)
+			}
+			out = append(out, byte(len(class)))
+			out = append(out, class...)
+			out = append(out, classEndMarker)
+			i = j
+
+		case b == '*' && i+1 < len(key) && key[i+1] == '{':
+			j := i + 2
+			start := j
+			for j < len(key) && key[j] != '}' {
+				j++
+			}
+			if j >= len(key) {
+				return nil, ErrInvalidPattern
+			}
+			lo, hi, err := parseBounds(key[start:j])
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, boundedStarMarker, lo, hi)
+			i = j
+
+		default:
+			out = append(out, b)
+		}
+	}
+	return out, nil
+}
+
+// parseBounds parses the "m,n" or "m" inside a '*{m,n}' token.
+func parseBounds(spec []byte) (lo, hi byte, err error) {
+	s := string(spec)
+	comma := bytes.IndexByte(spec, ',')
+	if comma < 0 {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 || n > 255 {
+			return 0, 0, ErrInvalidPattern
+		}
+		return byte(n), byte(n), nil
+	}
+	lon, err1 := strconv.Atoi(s[:comma])
+	hin, err2 := strconv.Atoi(s[comma+1:])
+	if err1 != nil || err2 != nil || lon < 0 || hin > 255 || lon > hin {
+		return 0, 0, ErrInvalidPattern
+	}
+	return byte(lon), byte(hin), nil
+}
+
+// labelChild is one direct child of a node together with the label it's
+// reached by.
+type labelChild struct {
+	label byte
+	to    int
+}
+
+// children returns every direct child of nid, walking the sibling ring the
+// same way childCount/buildBitmap already do for the dense-node bitmap.
+// Descriptor bytes laid down by compilePattern are ordinary trie bytes, so
+// two rules that agree up to some point in a '[abc]'/'*{m,n}' descriptor but
+// diverge after it are an ordinary trie branch here: decoding a descriptor
+// correctly means walking all of a node's children at each step, not just
+// the first one.
+func (da *Cedar) children(nid int) []labelChild {
+	var out []labelChild
+	for c := da.info[nid].Child; c != 0; {
+		to := da.array[nid].base() ^ int(c)
+		out = append(out, labelChild{label: c, to: to})
+		c = da.info[to].Sibling
+	}
+	return out
+}
+
+// classDesc is one decoded '[abc]'/'[^abc]' descriptor: its negation flag,
+// member bytes, and the node the rest of that rule continues from.
+type classDesc struct {
+	negated bool
+	members []byte
+	cont    int
+}
+
+// readClasses decodes every class descriptor reachable from a classMarker
+// child cnid. A single cnid roots more than one descriptor when two
+// '[...]' rules share a trie prefix up to and including the classMarker
+// byte but differ in negation, member count or members themselves; each of
+// those differences is a branch somewhere in the descriptor chain, so all
+// branches have to be explored to recover every rule's members instead of
+// just the first child found at each step.
+func (da *Cedar) readClasses(cnid int) []classDesc {
+	var out []classDesc
+	for _, negC := range da.children(cnid) {
+		if negC.label != classNegated && negC.label != classNotNegated {
+			continue
+		}
+		negated := negC.label == classNegated
+		for _, cntC := range da.children(negC.to) {
+			out = append(out, da.readClassMembers(negated, int(cntC.label), cntC.to, nil)...)
+		}
+	}
+	return out
+}
+
+// readClassMembers walks the remaining member bytes of a class descriptor,
+// branching at every node that has more than one child, and returns one
+// classDesc per classEndMarker edge it reaches.
+func (da *Cedar) readClassMembers(negated bool, remaining int, nid int, members []byte) []classDesc {
+	if remaining == 0 {
+		var out []classDesc
+		for _, endC := range da.children(nid) {
+			if endC.label != classEndMarker {
+				continue
+			}
+			out = append(out, classDesc{negated: negated, members: members, cont: endC.to})
+		}
+		return out
+	}
+	var out []classDesc
+	for _, mc := range da.children(nid) {
+		next := make([]byte, len(members)+1)
+		copy(next, members)
+		next[len(members)] = mc.label
+		out = append(out, da.readClassMembers(negated, remaining-1, mc.to, next)...)
+	}
+	return out
+}
+
+// classMatches reports whether b satisfies some class rule rooted at cnid (a
+// classMarker child, as returned by child(nid, classMarker)) and, if so, the
+// node that rule's rest continues from. It wraps readClasses so callers that
+// only need a yes/no answer, such as matchStep and the FindOne/FindAll
+// backtrack-stack pushes, don't have to know the class descriptor layout.
+func (da *Cedar) classMatches(cnid int, b byte) (cont int, ok bool) {
+	for _, cd := range da.readClasses(cnid) {
+		if bytes.IndexByte(cd.members, b) >= 0 != cd.negated {
+			return cd.cont, true
+		}
+	}
+	return 0, false
+}
+
+// boundedStarDesc is one decoded '*{m,n}' descriptor: its low/high byte
+// counts and the node the rest of that rule continues from.
+type boundedStarDesc struct {
+	lo, hi byte
+	cont   int
+}
+
+// readBoundedStars decodes every '*{m,n}' descriptor reachable from a
+// boundedStarMarker child bsnid. As with readClasses, more than one lives
+// under the same bsnid when two bounded-star rules share a trie prefix up
+// to the marker but differ in lo and/or hi.
+func (da *Cedar) readBoundedStars(bsnid int) []boundedStarDesc {
+	var out []boundedStarDesc
+	for _, loC := range da.children(bsnid) {
+		for _, hiC := range da.children(loC.to) {
+			out = append(out, boundedStarDesc{lo: loC.label, hi: hiC.label, cont: hiC.to})
+		}
+	}
+	return out
+}
+
+// matchStep tries to consume one matching unit of the input starting at
+// key[i] from nid, honoring a literal label, a '?' (anyMarker), or a
+// '[abc]'/'[^abc]' class; consumed reports how many bytes of key that unit
+// took, which is always 1 for a literal label but, in ModeUTF8, a full rune
+// (the class/'?' membership test still only looks at the rune's lead byte)
+// for anyMarker/classMarker. It does not handle '*' or '*{m,n}', which can
+// consume more than one unit and are driven from the DFS stack in
+// FindOne/FindAll instead. badUTF8 reports a malformed rune at key[i] in
+// ModeUTF8.
+func (da *Cedar) matchStep(key []byte, i, nid int) (to, consumed int, matched, badUTF8 bool) {
+	b := key[i]
+	if da.fastHasLabel(nid, b) {
+		to, _ = da.child(nid, b)
+		return to, 1, true, false
+	}
+	if da.fastHasLabel(nid, anyMarker) {
+		next, err := da.advance(key, i)
+		if err != nil {
+			return 0, 0, false, true
+		}
+		to, _ = da.child(nid, anyMarker)
+		return to, next - i, true, false
+	}
+	if da.fastHasLabel(nid, classMarker) {
+		cnid, _ := da.child(nid, classMarker)
+		if cont, ok := da.classMatches(cnid, b); ok {
+			next, err := da.advance(key, i)
+			if err != nil {
+				return 0, 0, false, true
+			}
+			return cont, next - i, true, false
+		}
+	}
+	return 0, 0, false, false
+}
@@ -0,0 +1,78 @@
+package cedar
+
+import "testing"
+
+func TestFindOneGrammar(t *testing.T) {
+	m := NewCedar()
+
+	_ = m.Insert([]byte("GET /user/?/profile"), 1)
+	_ = m.Insert([]byte("GET /color/[rgb]/hex"), 2)
+	_ = m.Insert([]byte("GET /path/*{1,3}/end"), 3)
+
+	cases := []struct {
+		key  string
+		want int
+	}{
+		{"GET /user/5/profile", 1},
+		{"GET /color/g/hex", 2},
+		{"GET /path/a/end", 3},
+		{"GET /path/a/b/end", 3},
+	}
+
+	for _, c := range cases {
+		v, err := m.FindOne([]byte(c.key))
+		if err != nil {
+			t.Errorf("FindOne(%q): %v", c.key, err)
+			continue
+		}
+		if iv, ok := v.(int); !ok || iv != c.want {
+			t.Errorf("FindOne(%q) = %v, want %d", c.key, v, c.want)
+		}
+	}
+
+	if _, err := m.FindOne([]byte("GET /color/x/hex")); err == nil {
+		t.Errorf("FindOne should not match a letter outside the [rgb] class")
+	}
+
+	if _, err := m.FindOne([]byte("GET /path/a/b/c/d/end")); err == nil {
+		t.Errorf("FindOne should not match more than 3 bytes for *{1,3}")
+	}
+}
+
+// TestFindOneSharedClassPrefix covers two '[...]' rules (and two '*{m,n}'
+// rules) that share a trie prefix up to and including the marker byte but
+// diverge in their descriptor: distinct members in one case, distinct
+// bounds in the other. Both descriptors hang off the same marker child, so
+// decoding has to walk every branch of the descriptor instead of always
+// taking the first one found.
+func TestFindOneSharedClassPrefix(t *testing.T) {
+	m := NewCedar()
+
+	_ = m.Insert([]byte("a[bc]x"), 1)
+	_ = m.Insert([]byte("a[de]y"), 2)
+	_ = m.Insert([]byte("p*{1,2}q"), 3)
+	_ = m.Insert([]byte("p*{3,4}r"), 4)
+
+	cases := []struct {
+		key  string
+		want int
+	}{
+		{"abx", 1},
+		{"acx", 1},
+		{"ady", 2},
+		{"aey", 2},
+		{"paq", 3},
+		{"paaaar", 4},
+	}
+
+	for _, c := range cases {
+		v, err := m.FindOne([]byte(c.key))
+		if err != nil {
+			t.Errorf("FindOne(%q): %v", c.key, err)
+			continue
+		}
+		if iv, ok := v.(int); !ok || iv != c.want {
+			t.Errorf("FindOne(%q) = %v, want %d", c.key, v, c.want)
+		}
+	}
+}